@@ -0,0 +1,155 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+// Package message defines the wire format for Heka messages, including the
+// stream framing header and the message envelope itself.
+package message
+
+// Framing bytes used to delimit a header/message pair on the wire.
+const (
+	RECORD_SEPARATOR = byte(0x1e)
+	UNIT_SEPARATOR   = byte(0x1f)
+
+	// MAX_HEADER_SIZE is the largest a marshalled Header may be; its length
+	// is encoded in a single byte immediately following RECORD_SEPARATOR.
+	MAX_HEADER_SIZE = 255
+	// MAX_MESSAGE_SIZE is the largest a marshalled Message may be.
+	MAX_MESSAGE_SIZE = 64 * 1024
+)
+
+// Header_MessageEncoding identifies the wire encoding used for the Message
+// that follows a Header.
+type Header_MessageEncoding int32
+
+const (
+	Header_PROTOCOL_BUFFER Header_MessageEncoding = 0
+	Header_JSON            Header_MessageEncoding = 1
+	Header_MSGPACK         Header_MessageEncoding = 2
+)
+
+// Header_HmacHashFunction identifies the hash function used to compute an
+// HMAC signature over a message's bytes.
+type Header_HmacHashFunction int32
+
+const (
+	Header_MD5    Header_HmacHashFunction = 0
+	Header_SHA1   Header_HmacHashFunction = 1
+	Header_SHA256 Header_HmacHashFunction = 2
+	Header_SHA512 Header_HmacHashFunction = 3
+)
+
+// Header precedes every Message on the wire. Most fields are optional, which
+// is why they're represented as pointers; the Get/Set accessors hide the nil
+// checks from callers.
+type Header struct {
+	MessageLength    *uint32                  `protobuf:"varint,1,req,name=message_length" json:"message_length,omitempty"`
+	MessageEncoding  *Header_MessageEncoding  `protobuf:"varint,2,opt,name=message_encoding,enum=message.Header_MessageEncoding,def=0" json:"message_encoding,omitempty"`
+	HmacHashFunction *Header_HmacHashFunction `protobuf:"varint,3,opt,name=hmac_hash_function,enum=message.Header_HmacHashFunction,def=0" json:"hmac_hash_function,omitempty"`
+	HmacSigner       *string                  `protobuf:"bytes,4,opt,name=hmac_signer" json:"hmac_signer,omitempty"`
+	HmacKeyVersion   *uint32                  `protobuf:"varint,5,opt,name=hmac_key_version,def=0" json:"hmac_key_version,omitempty"`
+	Hmac             []byte                   `protobuf:"bytes,6,opt,name=hmac" json:"hmac,omitempty"`
+}
+
+func (h *Header) Reset()         { *h = Header{} }
+func (h *Header) String() string { return "Header" }
+func (*Header) ProtoMessage()    {}
+
+func (h *Header) GetMessageLength() uint32 {
+	if h != nil && h.MessageLength != nil {
+		return *h.MessageLength
+	}
+	return 0
+}
+
+func (h *Header) SetMessageLength(v uint32) { h.MessageLength = &v }
+
+func (h *Header) GetMessageEncoding() Header_MessageEncoding {
+	if h != nil && h.MessageEncoding != nil {
+		return *h.MessageEncoding
+	}
+	return Header_PROTOCOL_BUFFER
+}
+
+func (h *Header) SetMessageEncoding(v Header_MessageEncoding) { h.MessageEncoding = &v }
+
+func (h *Header) GetHmacHashFunction() Header_HmacHashFunction {
+	if h != nil && h.HmacHashFunction != nil {
+		return *h.HmacHashFunction
+	}
+	return Header_MD5
+}
+
+func (h *Header) SetHmacHashFunction(v Header_HmacHashFunction) { h.HmacHashFunction = &v }
+
+func (h *Header) GetHmacSigner() string {
+	if h != nil && h.HmacSigner != nil {
+		return *h.HmacSigner
+	}
+	return ""
+}
+
+func (h *Header) SetHmacSigner(v string) { h.HmacSigner = &v }
+
+func (h *Header) GetHmacKeyVersion() uint32 {
+	if h != nil && h.HmacKeyVersion != nil {
+		return *h.HmacKeyVersion
+	}
+	return 0
+}
+
+func (h *Header) SetHmacKeyVersion(v uint32) { h.HmacKeyVersion = &v }
+
+func (h *Header) GetHmac() []byte { return h.Hmac }
+
+func (h *Header) SetHmac(v []byte) { h.Hmac = v }
+
+// Message is the core Heka data envelope. Fields is a free-form bag of
+// string metadata attached by inputs/decoders/filters as a message flows
+// through the pipeline.
+type Message struct {
+	Timestamp  *int64            `json:"timestamp,omitempty"`
+	Type       *string           `json:"type,omitempty"`
+	Logger     *string           `json:"logger,omitempty"`
+	Severity   *int32            `json:"severity,omitempty"`
+	Payload    *string           `json:"payload,omitempty"`
+	EnvVersion *string           `json:"env_version,omitempty"`
+	Pid        *int32            `json:"pid,omitempty"`
+	Hostname   *string           `json:"hostname,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return "Message" }
+func (*Message) ProtoMessage()    {}
+
+func (m *Message) GetTimestamp() int64 {
+	if m != nil && m.Timestamp != nil {
+		return *m.Timestamp
+	}
+	return 0
+}
+
+func (m *Message) GetType() string {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return ""
+}
+
+func (m *Message) GetPayload() string {
+	if m != nil && m.Payload != nil {
+		return *m.Payload
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Rejection reasons recorded via InputRunner.CountRejection.
+const (
+	RejectBadHmac        = "bad-hmac"
+	RejectUnknownVersion = "unknown-version"
+	RejectExpiredVersion = "expired-version"
+)
+
+type iRunner struct {
+	name            string
+	input           Input
+	inChan          chan *PipelinePack
+	rejectionMu     sync.Mutex
+	rejectionCounts map[string]int64
+}
+
+// NewInputRunner wraps an Input plugin so it can be started and supervised
+// by the pipeline.
+func NewInputRunner(name string, input Input) InputRunner {
+	return &iRunner{name: name, input: input}
+}
+
+func (ir *iRunner) Name() string               { return ir.name }
+func (ir *iRunner) Input() Input               { return ir.input }
+func (ir *iRunner) InChan() chan *PipelinePack { return ir.inChan }
+
+func (ir *iRunner) LogError(err error) {
+	log.Printf("Error processing input '%s': %s", ir.name, err)
+}
+
+func (ir *iRunner) CountRejection(reason string) {
+	ir.rejectionMu.Lock()
+	defer ir.rejectionMu.Unlock()
+	if ir.rejectionCounts == nil {
+		ir.rejectionCounts = make(map[string]int64)
+	}
+	ir.rejectionCounts[reason]++
+}
+
+func (ir *iRunner) RejectionCounts() map[string]int64 {
+	ir.rejectionMu.Lock()
+	defer ir.rejectionMu.Unlock()
+	counts := make(map[string]int64, len(ir.rejectionCounts))
+	for reason, n := range ir.rejectionCounts {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// Start pulls the pack supply channel from the helper and launches the
+// wrapped Input's Run method in its own goroutine. A panic inside Run is
+// recovered and logged rather than being allowed to crash the process.
+func (ir *iRunner) Start(h PluginHelper, wg *sync.WaitGroup) {
+	ir.inChan = h.PackSupply()
+	go func() {
+		defer wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				ir.LogError(fmt.Errorf("panic in input '%s': %v", ir.name, r))
+			}
+		}()
+		if err := ir.input.Run(ir, h); err != nil {
+			ir.LogError(err)
+		}
+	}()
+}
@@ -0,0 +1,410 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"code.google.com/p/goprotobuf/proto"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/mozilla-services/heka/message"
+	"hash"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout is how long TcpInput.Stop waits for in-flight
+// connections to finish when a config doesn't set ShutdownTimeout.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// UdpInputConfig is the config struct for a UdpInput plugin.
+type UdpInputConfig struct {
+	// Network address to listen to; has the form "host:port".
+	Address string
+	// Encoding of the datagrams this input receives. Defaults to
+	// message.Header_JSON if left unset.
+	Encoding message.Header_MessageEncoding
+}
+
+// UdpInput listens on a UDP socket for single-datagram messages, encoded
+// per its configured Encoding (JSON by default).
+type UdpInput struct {
+	listener net.Conn
+	encoding message.Header_MessageEncoding
+}
+
+func (u *UdpInput) Init(config interface{}) (err error) {
+	conf := config.(*UdpInputConfig)
+	addr, err := net.ResolveUDPAddr("udp", conf.Address)
+	if err != nil {
+		return fmt.Errorf("UdpInput: can't resolve %s: %s", conf.Address, err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("UdpInput: can't listen on %s: %s", conf.Address, err)
+	}
+	u.listener = conn
+	u.encoding = conf.Encoding
+	if u.encoding == message.Header_PROTOCOL_BUFFER {
+		u.encoding = message.Header_JSON
+	}
+	return nil
+}
+
+func (u *UdpInput) Run(ir InputRunner, h PluginHelper) (err error) {
+	decoders := h.DecodersByEncoding()
+	decoder := decoders[u.encoding]
+	for {
+		packSupply := ir.InChan()
+		pack := <-packSupply
+		n, err := u.listener.Read(pack.MsgBytes)
+		if err != nil {
+			// Return the pack we'd checked out rather than dropping it, so
+			// a Stop-triggered shutdown doesn't leak it out of the supply.
+			packSupply <- pack
+			return err
+		}
+		pack.MsgBytes = pack.MsgBytes[:n]
+		decoder.InChan() <- pack
+	}
+}
+
+func (u *UdpInput) Stop() {
+	u.listener.Close()
+}
+
+// TcpInputConfig is the config struct for a TcpInput plugin.
+type TcpInputConfig struct {
+	// Network address to listen to; has the form "host:port".
+	Address string
+	// Signers is a map of signer name to the Signer (and its rotating key
+	// versions) used to verify that signer's HMAC-signed incoming
+	// messages.
+	Signers map[string]Signer
+
+	// UseTLS turns on TLS for this input's listener.
+	UseTLS bool
+	// Paths to the PEM encoded server certificate and private key, used
+	// when UseTLS is true.
+	CertFile string
+	KeyFile  string
+	// Path to a PEM encoded CA bundle used to verify client certificates.
+	CAFile string
+	// Mirrors tls.ClientAuthType; controls whether/how client certificates
+	// are requested and verified.
+	ClientAuth tls.ClientAuthType
+	// Cipher suite names (e.g. "TLS_RSA_WITH_AES_256_CBC_SHA") to restrict
+	// the TLS handshake to. An empty list allows Go's default set.
+	CipherSuites []string
+
+	// ShutdownTimeout bounds how long Stop waits for in-flight connection
+	// goroutines to finish before giving up and returning anyway. Defaults
+	// to DefaultShutdownTimeout if zero.
+	ShutdownTimeout time.Duration
+}
+
+// TcpInput listens on a TCP socket for framed, HMAC-signable messages and
+// hands each off to the decoder matching its header's message encoding.
+// When configured with UseTLS, a verified client certificate's CommonName
+// is used as the message's signer, taking precedence over any HMAC-derived
+// signer.
+type TcpInput struct {
+	listener        net.Listener
+	signers         map[string]Signer
+	shutdownTimeout time.Duration
+	connWg          sync.WaitGroup
+}
+
+func (t *TcpInput) Init(config interface{}) (err error) {
+	conf := config.(*TcpInputConfig)
+	addr, err := net.ResolveTCPAddr("tcp", conf.Address)
+	if err != nil {
+		return fmt.Errorf("TcpInput: can't resolve %s: %s", conf.Address, err)
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("TcpInput: can't listen on %s: %s", conf.Address, err)
+	}
+
+	t.listener = listener
+	if conf.UseTLS {
+		tlsConfig, err := makeTlsConfig(conf)
+		if err != nil {
+			return fmt.Errorf("TcpInput: %s", err)
+		}
+		t.listener = tls.NewListener(listener, tlsConfig)
+	}
+	t.signers = conf.Signers
+	t.shutdownTimeout = conf.ShutdownTimeout
+	if t.shutdownTimeout <= 0 {
+		t.shutdownTimeout = DefaultShutdownTimeout
+	}
+	return nil
+}
+
+// makeTlsConfig builds a *tls.Config from a TcpInputConfig's TLS settings.
+func makeTlsConfig(conf *TcpInputConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't load certificate/key: %s", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   conf.ClientAuth,
+	}
+
+	if conf.CAFile != "" {
+		caBytes, err := ioutil.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("can't parse CA file: %s", conf.CAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	if len(conf.CipherSuites) > 0 {
+		suites := make([]uint16, 0, len(conf.CipherSuites))
+		for _, name := range conf.CipherSuites {
+			suite, ok := cipherSuitesByName[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown cipher suite: %q", name)
+			}
+			suites = append(suites, suite)
+		}
+		tlsConfig.CipherSuites = suites
+	}
+
+	return tlsConfig, nil
+}
+
+var cipherSuitesByName = map[string]uint16{
+	"TLS_RSA_WITH_RC4_128_SHA":           tls.TLS_RSA_WITH_RC4_128_SHA,
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":      tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":       tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":       tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_RC4_128_SHA":     tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA": tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA": tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+}
+
+func (t *TcpInput) Run(ir InputRunner, h PluginHelper) (err error) {
+	decoders := h.DecodersByEncoding()
+	packSupply := ir.InChan()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if neterr, ok := err.(net.Error); ok && !neterr.Temporary() {
+				return nil
+			}
+			continue
+		}
+		t.connWg.Add(1)
+		go t.handleConnection(conn, ir, packSupply, decoders)
+	}
+}
+
+// handleConnection reads and processes frames from conn until a read from
+// it fails (e.g. the peer closes it). Stop doesn't close open connections;
+// it only waits for them, up to its timeout. A panic anywhere below (e.g. in a
+// decoder's InChan, or while verifying a signature) is recovered here,
+// logged, and ends only this connection; Run's Accept loop is unaffected.
+func (t *TcpInput) handleConnection(conn net.Conn, ir InputRunner, packSupply chan *PipelinePack,
+	decoders []DecoderRunner) {
+
+	defer t.connWg.Done()
+	defer conn.Close()
+	defer func() {
+		if r := recover(); r != nil {
+			ir.LogError(fmt.Errorf("panic handling connection: %v", r))
+		}
+	}()
+
+	tlsSigner := t.tlsSigner(conn)
+	buf := make([]byte, message.MAX_MESSAGE_SIZE+message.MAX_HEADER_SIZE)
+	for {
+		n, readErr := conn.Read(buf)
+		if n > 0 {
+			t.processFrame(buf[:n], tlsSigner, ir, packSupply, decoders)
+		}
+		if readErr != nil {
+			return
+		}
+	}
+}
+
+// tlsSigner returns the CommonName of conn's verified client certificate,
+// if conn is a TLS connection that presented one, or "" otherwise. This is
+// resolved once per connection, since the same certificate applies to
+// every frame conn delivers.
+func (t *TcpInput) tlsSigner(conn net.Conn) string {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return ""
+	}
+	chains := tlsConn.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ""
+	}
+	return chains[0][0].Subject.CommonName
+}
+
+func (t *TcpInput) processFrame(frame []byte, tlsSigner string, ir InputRunner,
+	packSupply chan *PipelinePack, decoders []DecoderRunner) {
+
+	header, mbytes, err := decodeHeader(frame)
+	if err != nil {
+		ir.LogError(err)
+		return
+	}
+
+	encoding := header.GetMessageEncoding()
+	pack := <-packSupply
+
+	// Once a pack is checked out, any panic below (e.g. from verifySigner's
+	// hash lookup, or a decoder's InChan) must still return it to
+	// packSupply before propagating, so a single bad frame can't leak a
+	// pack out of circulation. The outer handleConnection recover does the
+	// actual logging once this has run.
+	defer func() {
+		if r := recover(); r != nil {
+			packSupply <- pack
+			panic(r)
+		}
+	}()
+
+	// A verified client certificate identifies its signer outright; HMAC
+	// verification is only consulted when the connection isn't using one.
+	signerName := tlsSigner
+	if signerName == "" {
+		var reason string
+		var ok bool
+		signerName, reason, ok = t.verifySigner(header, mbytes)
+		if !ok {
+			ir.CountRejection(reason)
+			packSupply <- pack
+			return
+		}
+	}
+
+	pack.MsgBytes = append(pack.MsgBytes[:0], mbytes...)
+	pack.Signer = signerName
+
+	if int(encoding) >= len(decoders) || decoders[encoding] == nil {
+		ir.LogError(fmt.Errorf("no decoder registered for encoding %d", encoding))
+		packSupply <- pack
+		return
+	}
+	decoders[encoding].InChan() <- pack
+}
+
+// hmacHashFuncs maps a Header_HmacHashFunction to the hash.Hash constructor
+// verifySigner uses to check a message's signature. It's a var rather than
+// a switch so tests can substitute an entry to exercise unusual hash
+// behavior.
+var hmacHashFuncs = map[message.Header_HmacHashFunction]func() hash.Hash{
+	message.Header_MD5:    md5.New,
+	message.Header_SHA1:   sha1.New,
+	message.Header_SHA256: sha256.New,
+	message.Header_SHA512: sha512.New,
+}
+
+// verifySigner checks a message's HMAC signature, if one is present,
+// against the TcpInput's configured signers. An unsigned message is
+// considered valid; the returned signer name is then empty. reason is one
+// of the Reject* constants and is only meaningful when ok is false.
+func (t *TcpInput) verifySigner(header *message.Header, mbytes []byte) (signer, reason string, ok bool) {
+	signer = header.GetHmacSigner()
+	if signer == "" {
+		return "", "", true
+	}
+
+	s, present := t.signers[signer]
+	if !present {
+		return "", RejectUnknownVersion, false
+	}
+	key, present := s.Versions[header.GetHmacKeyVersion()]
+	if !present {
+		return "", RejectUnknownVersion, false
+	}
+
+	now := time.Now()
+	if (!key.NotBefore.IsZero() && now.Before(key.NotBefore)) ||
+		(!key.NotAfter.IsZero() && now.After(key.NotAfter)) {
+		return "", RejectExpiredVersion, false
+	}
+
+	newHash, ok := hmacHashFuncs[header.GetHmacHashFunction()]
+	if !ok {
+		return "", RejectBadHmac, false
+	}
+	digest := hmac.New(newHash, []byte(key.Key))
+	digest.Write(mbytes)
+	if !hmac.Equal(digest.Sum(nil), header.GetHmac()) {
+		return "", RejectBadHmac, false
+	}
+	return signer, "", true
+}
+
+// Stop closes the listener, so Run's Accept loop returns, then waits up to
+// t.shutdownTimeout for in-flight handleConnection goroutines to drain
+// before returning regardless.
+func (t *TcpInput) Stop() {
+	t.listener.Close()
+	done := make(chan struct{})
+	go func() {
+		t.connWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(t.shutdownTimeout):
+	}
+}
+
+// decodeHeader pulls the message.Header and the raw message bytes out of a
+// RECORD_SEPARATOR / UNIT_SEPARATOR framed buffer.
+func decodeHeader(frame []byte) (header *message.Header, mbytes []byte, err error) {
+	if len(frame) < 3 || frame[0] != message.RECORD_SEPARATOR {
+		return nil, nil, errors.New("missing record separator")
+	}
+	hlen := int(frame[1])
+	if len(frame) < 2+hlen+1 {
+		return nil, nil, errors.New("truncated header")
+	}
+	header = new(message.Header)
+	if err = proto.Unmarshal(frame[2:2+hlen], header); err != nil {
+		return nil, nil, fmt.Errorf("can't unmarshal header: %s", err)
+	}
+	pos := 2 + hlen
+	if frame[pos] != message.UNIT_SEPARATOR {
+		return nil, nil, errors.New("missing unit separator")
+	}
+	return header, frame[pos+1:], nil
+}
@@ -18,13 +18,26 @@ import (
 	"code.google.com/p/goprotobuf/proto"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"github.com/mozilla-services/heka/message"
 	ts "github.com/mozilla-services/heka/testsupport"
 	gs "github.com/rafrombrc/gospec/src/gospec"
+	"github.com/vmihailenco/msgpack"
+	"hash"
+	"io/ioutil"
+	"math/big"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
@@ -66,6 +79,92 @@ func getPayloadBytes(hbytes, mbytes []byte) func(msgBytes []byte) {
 	}
 }
 
+func frameMessage(header *message.Header, mbytes []byte) []byte {
+	hbytes, _ := proto.Marshal(header)
+	frame := make([]byte, 0, 3+len(hbytes)+len(mbytes))
+	frame = append(frame, message.RECORD_SEPARATOR, byte(len(hbytes)))
+	frame = append(frame, hbytes...)
+	frame = append(frame, message.UNIT_SEPARATOR)
+	frame = append(frame, mbytes...)
+	return frame
+}
+
+// testCA is a throwaway self-signed CA used to mint the server and client
+// certificates exercised by the TLS specs below.
+type testCA struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+func newTestCA() *testCA {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "heka-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// sign mints a leaf certificate for commonName. dnsName is only set on
+// server certificates, where it's matched against the client's ServerName.
+func (ca *testCA) sign(commonName, dnsName string) (certPEM, keyPEM []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if dnsName != "" {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{dnsName}
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		panic(err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return
+}
+
+func writeTempFile(contents []byte) string {
+	f, err := ioutil.TempFile("", "heka-tls-test")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	if _, err = f.Write(contents); err != nil {
+		panic(err)
+	}
+	return f.Name()
+}
+
 func InputsSpec(c gs.Context) {
 	t := &ts.SimpleT{}
 	ctrl := gomock.NewController(t)
@@ -82,18 +181,24 @@ func InputsSpec(c gs.Context) {
 	// set up mock helper, decoder set, and packSupply channel
 	ith.MockHelper = NewMockPluginHelper(ctrl)
 	ith.MockInputRunner = NewMockInputRunner(ctrl)
-	ith.Decoders = make([]DecoderRunner, int(message.Header_JSON+1))
+	ith.Decoders = make([]DecoderRunner, int(message.Header_MSGPACK+1))
 	ith.Decoders[message.Header_PROTOCOL_BUFFER] = NewMockDecoderRunner(ctrl)
 	ith.Decoders[message.Header_JSON] = NewMockDecoderRunner(ctrl)
+	ith.Decoders[message.Header_MSGPACK] = NewMockDecoderRunner(ctrl)
 	ith.PackSupply = make(chan *PipelinePack, 1)
 	ith.DecodeChan = make(chan *PipelinePack)
 	key := "testkey"
-	signers := map[string]Signer{"test_1": {key}}
 	signer := "test"
+	signers := map[string]Signer{
+		signer: {Versions: map[uint32]SignerKey{
+			1: {Key: key},
+			2: {Key: key, NotAfter: time.Now().Add(-time.Hour)},
+		}},
+	}
 
 	c.Specify("A UdpInput", func() {
 		udpInput := UdpInput{}
-		err := udpInput.Init(&UdpInputConfig{ith.AddrStr})
+		err := udpInput.Init(&UdpInputConfig{Address: ith.AddrStr})
 		c.Assume(err, gs.IsNil)
 		realListener := (udpInput.listener).(*net.UDPConn)
 		c.Expect(realListener.LocalAddr().String(), gs.Equals, ith.ResolvedAddrStr)
@@ -128,11 +233,37 @@ func InputsSpec(c gs.Context) {
 			c.Expect(string(ith.Pack.MsgBytes), gs.Equals, string(msgJson))
 			c.Expect(ith.Pack.Decoded, gs.IsFalse)
 		})
+
+		c.Specify("reads a msgpack encoded message from the connection and passes it to the decoder", func() {
+			udpInput.encoding = message.Header_MSGPACK
+			msgPack, _ := msgpack.Marshal(ith.Msg)
+			putMsgPackInBytes := func(msgBytes []byte) {
+				copy(msgBytes, msgPack)
+			}
+
+			ith.MockHelper.EXPECT().DecodersByEncoding().Return(ith.Decoders)
+			readCall := mockListener.EXPECT().Read(ith.Pack.MsgBytes)
+			readCall.Return(len(msgPack), nil)
+			readCall.Do(putMsgPackInBytes)
+
+			mockDecoderRunner := ith.Decoders[message.Header_MSGPACK].(*MockDecoderRunner)
+			mockDecoderRunner.EXPECT().InChan().Return(ith.DecodeChan)
+			ith.MockInputRunner.EXPECT().InChan().Times(2).Return(ith.PackSupply)
+
+			go func() {
+				udpInput.Run(ith.MockInputRunner, ith.MockHelper)
+			}()
+			ith.PackSupply <- ith.Pack
+			packRef := <-ith.DecodeChan
+			c.Expect(ith.Pack, gs.Equals, packRef)
+			c.Expect(string(ith.Pack.MsgBytes), gs.Equals, string(msgPack))
+			c.Expect(ith.Pack.Decoded, gs.IsFalse)
+		})
 	})
 
 	c.Specify("A TcpInput", func() {
 		tcpInput := TcpInput{}
-		err := tcpInput.Init(&TcpInputConfig{ith.AddrStr, signers})
+		err := tcpInput.Init(&TcpInputConfig{Address: ith.AddrStr, Signers: signers})
 		c.Assume(err, gs.IsNil)
 		realListener := tcpInput.listener
 		c.Expect(realListener.Addr().String(), gs.Equals, ith.ResolvedAddrStr)
@@ -238,7 +369,69 @@ func InputsSpec(c gs.Context) {
 			}
 		})
 
-		c.Specify("reads a signed message with an expired key from its connection", func() {
+		c.Specify("reads a SHA256 signed message from its connection", func() {
+			header.SetHmacHashFunction(message.Header_SHA256)
+			header.SetHmacSigner(signer)
+			header.SetHmacKeyVersion(uint32(1))
+			hm := hmac.New(sha256.New, []byte(key))
+			hm.Write(mbytes)
+			header.SetHmac(hm.Sum(nil))
+			hbytes, _ := proto.Marshal(header)
+			buflen := 3 + len(hbytes) + len(mbytes)
+			readCall.Return(buflen, err)
+			readCall.Do(getPayloadBytes(hbytes, mbytes))
+
+			go func() {
+				tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+			}()
+			ith.PackSupply <- ith.Pack
+			timeout := make(chan bool, 1)
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				timeout <- true
+			}()
+			select {
+			case packRef := <-ith.DecodeChan:
+				c.Expect(ith.Pack, gs.Equals, packRef)
+				c.Expect(string(ith.Pack.MsgBytes), gs.Equals, string(mbytes))
+				c.Expect(ith.Pack.Signer, gs.Equals, "test")
+			case t := <-timeout:
+				c.Expect(t, gs.IsNil)
+			}
+		})
+
+		c.Specify("reads a SHA512 signed message from its connection", func() {
+			header.SetHmacHashFunction(message.Header_SHA512)
+			header.SetHmacSigner(signer)
+			header.SetHmacKeyVersion(uint32(1))
+			hm := hmac.New(sha512.New, []byte(key))
+			hm.Write(mbytes)
+			header.SetHmac(hm.Sum(nil))
+			hbytes, _ := proto.Marshal(header)
+			buflen := 3 + len(hbytes) + len(mbytes)
+			readCall.Return(buflen, err)
+			readCall.Do(getPayloadBytes(hbytes, mbytes))
+
+			go func() {
+				tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+			}()
+			ith.PackSupply <- ith.Pack
+			timeout := make(chan bool, 1)
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				timeout <- true
+			}()
+			select {
+			case packRef := <-ith.DecodeChan:
+				c.Expect(ith.Pack, gs.Equals, packRef)
+				c.Expect(string(ith.Pack.MsgBytes), gs.Equals, string(mbytes))
+				c.Expect(ith.Pack.Signer, gs.Equals, "test")
+			case t := <-timeout:
+				c.Expect(t, gs.IsNil)
+			}
+		})
+
+		c.Specify("reads a signed message with an unknown key version from its connection", func() {
 			header.SetHmacHashFunction(message.Header_MD5)
 			header.SetHmacSigner(signer)
 			header.SetHmacKeyVersion(uint32(11)) // non-existent key version
@@ -250,6 +443,34 @@ func InputsSpec(c gs.Context) {
 			readCall.Return(buflen, err)
 			readCall.Do(getPayloadBytes(hbytes, mbytes))
 
+			ith.MockInputRunner.EXPECT().CountRejection(RejectUnknownVersion)
+			go func() {
+				tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+			}()
+			ith.PackSupply <- ith.Pack
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				close(mockDecoderRunner.InChan())
+			}()
+			select {
+			case packRef := <-ith.DecodeChan:
+				c.Expect(packRef, gs.IsNil)
+			}
+		})
+
+		c.Specify("reads a signed message with an expired key version from its connection", func() {
+			header.SetHmacHashFunction(message.Header_MD5)
+			header.SetHmacSigner(signer)
+			header.SetHmacKeyVersion(uint32(2)) // version whose NotAfter has passed
+			hm := hmac.New(md5.New, []byte(key))
+			hm.Write(mbytes)
+			header.SetHmac(hm.Sum(nil))
+			hbytes, _ := proto.Marshal(header)
+			buflen := 3 + len(hbytes) + len(mbytes)
+			readCall.Return(buflen, err)
+			readCall.Do(getPayloadBytes(hbytes, mbytes))
+
+			ith.MockInputRunner.EXPECT().CountRejection(RejectExpiredVersion)
 			go func() {
 				tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
 			}()
@@ -276,6 +497,7 @@ func InputsSpec(c gs.Context) {
 			readCall.Return(buflen, err)
 			readCall.Do(getPayloadBytes(hbytes, mbytes))
 
+			ith.MockInputRunner.EXPECT().CountRejection(RejectBadHmac)
 			go func() {
 				tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
 			}()
@@ -291,6 +513,240 @@ func InputsSpec(c gs.Context) {
 		})
 	})
 
+	c.Specify("A TcpInput configured for TLS", func() {
+		ca := newTestCA()
+		serverCertPEM, serverKeyPEM := ca.sign("heka-server", "localhost")
+		clientCertPEM, clientKeyPEM := ca.sign("test-client", "")
+
+		certFile := writeTempFile(serverCertPEM)
+		defer os.Remove(certFile)
+		keyFile := writeTempFile(serverKeyPEM)
+		defer os.Remove(keyFile)
+		caFile := writeTempFile(ca.pem())
+		defer os.Remove(caFile)
+
+		tcpInput := TcpInput{}
+		err := tcpInput.Init(&TcpInputConfig{
+			Address:    ith.AddrStr,
+			UseTLS:     true,
+			CertFile:   certFile,
+			KeyFile:    keyFile,
+			CAFile:     caFile,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+		})
+		c.Assume(err, gs.IsNil)
+		defer tcpInput.Stop()
+
+		decodeChan := make(chan *PipelinePack)
+		packSupply := make(chan *PipelinePack, 1)
+		mockDecoderRunner := ith.Decoders[message.Header_PROTOCOL_BUFFER].(*MockDecoderRunner)
+		ith.MockHelper.EXPECT().DecodersByEncoding().Return(ith.Decoders)
+		ith.MockInputRunner.EXPECT().InChan().Return(packSupply)
+
+		go func() {
+			tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+		}()
+		packSupply <- getTestPipelinePack()
+
+		c.Specify("identifies the signer from the client's certificate", func() {
+			mockDecoderRunner.EXPECT().InChan().Return(decodeChan)
+
+			clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+			c.Assume(err, gs.IsNil)
+			rootPool := x509.NewCertPool()
+			rootPool.AppendCertsFromPEM(ca.pem())
+
+			clientConn, err := tls.Dial("tcp", ith.ResolvedAddrStr, &tls.Config{
+				Certificates: []tls.Certificate{clientCert},
+				RootCAs:      rootPool,
+				ServerName:   "localhost",
+			})
+			c.Assume(err, gs.IsNil)
+			defer clientConn.Close()
+
+			mbytes, _ := proto.Marshal(ith.Msg)
+			header := &message.Header{}
+			header.SetMessageLength(uint32(len(mbytes)))
+			_, err = clientConn.Write(frameMessage(header, mbytes))
+			c.Assume(err, gs.IsNil)
+
+			timeout := make(chan bool, 1)
+			go func() {
+				time.Sleep(2 * time.Second)
+				timeout <- true
+			}()
+			select {
+			case pack := <-decodeChan:
+				c.Expect(pack.Signer, gs.Equals, "test-client")
+				c.Expect(string(pack.MsgBytes), gs.Equals, string(mbytes))
+			case t := <-timeout:
+				c.Expect(t, gs.IsNil)
+			}
+		})
+
+		c.Specify("rejects a client that doesn't present a certificate", func() {
+			rootPool := x509.NewCertPool()
+			rootPool.AppendCertsFromPEM(ca.pem())
+
+			_, err := tls.Dial("tcp", ith.ResolvedAddrStr, &tls.Config{
+				RootCAs:    rootPool,
+				ServerName: "localhost",
+			})
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+	})
+
+	c.Specify("A TcpInput recovering from connection panics and shutting down gracefully", func() {
+		tcpInput := TcpInput{}
+		err := tcpInput.Init(&TcpInputConfig{
+			Address:         ith.AddrStr,
+			Signers:         signers,
+			ShutdownTimeout: 100 * time.Millisecond,
+		})
+		c.Assume(err, gs.IsNil)
+		defer tcpInput.Stop()
+
+		packSupply := make(chan *PipelinePack, 2)
+		decodeChan := make(chan *PipelinePack)
+		mockDecoderRunner := ith.Decoders[message.Header_PROTOCOL_BUFFER].(*MockDecoderRunner)
+		ith.MockHelper.EXPECT().DecodersByEncoding().Return(ith.Decoders)
+		ith.MockInputRunner.EXPECT().InChan().Return(packSupply)
+
+		go func() {
+			tcpInput.Run(ith.MockInputRunner, ith.MockHelper)
+		}()
+
+		mbytes, _ := proto.Marshal(ith.Msg)
+		header := &message.Header{}
+		header.SetMessageLength(uint32(len(mbytes)))
+
+		c.Specify("recovers from a panic in a decoder's InChan and keeps accepting", func() {
+			mockDecoderRunner.EXPECT().InChan().Do(func() { panic("decoder boom") })
+			ith.MockInputRunner.EXPECT().LogError(gs.Not(gs.IsNil))
+			packSupply <- getTestPipelinePack()
+
+			badConn, err := net.Dial("tcp", ith.ResolvedAddrStr)
+			c.Assume(err, gs.IsNil)
+			_, err = badConn.Write(frameMessage(header, mbytes))
+			c.Assume(err, gs.IsNil)
+			badConn.Close()
+
+			// A later connection is still served; the panic only took down
+			// the one goroutine handling badConn.
+			mockDecoderRunner.EXPECT().InChan().Return(decodeChan)
+			packSupply <- getTestPipelinePack()
+			goodConn, err := net.Dial("tcp", ith.ResolvedAddrStr)
+			c.Assume(err, gs.IsNil)
+			defer goodConn.Close()
+			_, err = goodConn.Write(frameMessage(header, mbytes))
+			c.Assume(err, gs.IsNil)
+
+			timeout := make(chan bool, 1)
+			go func() {
+				time.Sleep(2 * time.Second)
+				timeout <- true
+			}()
+			select {
+			case pack := <-decodeChan:
+				c.Expect(string(pack.MsgBytes), gs.Equals, string(mbytes))
+			case t := <-timeout:
+				c.Expect(t, gs.IsNil)
+			}
+		})
+
+		c.Specify("recovers from a panic in the HMAC verification path", func() {
+			savedMd5 := hmacHashFuncs[message.Header_MD5]
+			hmacHashFuncs[message.Header_MD5] = func() hash.Hash { panic("hmac boom") }
+			defer func() { hmacHashFuncs[message.Header_MD5] = savedMd5 }()
+
+			logged := make(chan bool, 1)
+			ith.MockInputRunner.EXPECT().LogError(gs.Not(gs.IsNil)).Do(func(err error) {
+				logged <- true
+			})
+			packSupply <- getTestPipelinePack()
+
+			header.SetHmacHashFunction(message.Header_MD5)
+			header.SetHmacSigner(signer)
+			header.SetHmacKeyVersion(uint32(1))
+			header.SetHmac([]byte("irrelevant, verification panics first"))
+
+			conn, err := net.Dial("tcp", ith.ResolvedAddrStr)
+			c.Assume(err, gs.IsNil)
+			defer conn.Close()
+			_, err = conn.Write(frameMessage(header, mbytes))
+			c.Assume(err, gs.IsNil)
+
+			// The checked-out pack must be salvaged back to packSupply
+			// rather than leaked when the connection's goroutine recovers.
+			// LogError only runs after the pack has been returned, so waiting
+			// for it first keeps the test from taking back its own pack
+			// before the connection has checked it out. timeout is closed
+			// rather than sent on so that both selects below see it.
+			timeout := make(chan bool, 1)
+			go func() {
+				time.Sleep(2 * time.Second)
+				close(timeout)
+			}()
+			select {
+			case <-logged:
+			case t := <-timeout:
+				c.Expect(t, gs.IsNil)
+			}
+			select {
+			case <-packSupply:
+			case t := <-timeout:
+				c.Expect(t, gs.IsNil)
+			}
+		})
+
+		c.Specify("Stop returns within ShutdownTimeout even with a connection still blocked reading", func() {
+			conn, err := net.Dial("tcp", ith.ResolvedAddrStr)
+			c.Assume(err, gs.IsNil)
+			defer conn.Close()
+			// give the Accept loop a moment to hand conn to handleConnection
+			time.Sleep(50 * time.Millisecond)
+
+			start := time.Now()
+			tcpInput.Stop()
+			c.Expect(time.Since(start) < time.Second, gs.IsTrue)
+		})
+	})
+
+	c.Specify("makeTlsConfig", func() {
+		ca := newTestCA()
+		serverCertPEM, serverKeyPEM := ca.sign("heka-server", "localhost")
+		certFile := writeTempFile(serverCertPEM)
+		defer os.Remove(certFile)
+		keyFile := writeTempFile(serverKeyPEM)
+		defer os.Remove(keyFile)
+
+		c.Specify("fails when the certificate/key pair can't be loaded", func() {
+			_, err := makeTlsConfig(&TcpInputConfig{CertFile: "no-such-file", KeyFile: keyFile})
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("fails on an unrecognized cipher suite name", func() {
+			_, err := makeTlsConfig(&TcpInputConfig{
+				CertFile:     certFile,
+				KeyFile:      keyFile,
+				CipherSuites: []string{"NOT_A_REAL_CIPHER_SUITE"},
+			})
+			c.Expect(err, gs.Not(gs.IsNil))
+		})
+
+		c.Specify("resolves configured cipher suite names", func() {
+			conf := &TcpInputConfig{
+				CertFile:     certFile,
+				KeyFile:      keyFile,
+				CipherSuites: []string{"TLS_RSA_WITH_AES_256_CBC_SHA"},
+			}
+			tlsConfig, err := makeTlsConfig(conf)
+			c.Assume(err, gs.IsNil)
+			c.Expect(len(tlsConfig.CipherSuites), gs.Equals, 1)
+			c.Expect(tlsConfig.CipherSuites[0], gs.Equals, uint16(tls.TLS_RSA_WITH_AES_256_CBC_SHA))
+		})
+	})
+
 	c.Specify("Runner recovers from panic in input's `Run()` method", func() {
 		input := new(PanicInput)
 		iRunner := NewInputRunner("panic", input)
@@ -300,4 +756,16 @@ func InputsSpec(c gs.Context) {
 		iRunner.Start(ith.MockHelper, &wg) // no panic => success
 		wg.Wait()
 	})
+
+	c.Specify("Runner tallies rejections by reason", func() {
+		iRunner := NewInputRunner("tcp", new(PanicInput))
+		iRunner.CountRejection(RejectBadHmac)
+		iRunner.CountRejection(RejectBadHmac)
+		iRunner.CountRejection(RejectUnknownVersion)
+
+		counts := iRunner.RejectionCounts()
+		c.Expect(counts[RejectBadHmac], gs.Equals, int64(2))
+		c.Expect(counts[RejectUnknownVersion], gs.Equals, int64(1))
+		c.Expect(counts[RejectExpiredVersion], gs.Equals, int64(0))
+	})
 }
@@ -0,0 +1,217 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"code.google.com/p/gomock/gomock"
+	"sync"
+)
+
+// MockPluginHelper is a gomock-based mock of PluginHelper.
+type MockPluginHelper struct {
+	ctrl     *gomock.Controller
+	recorder *_MockPluginHelperRecorder
+}
+
+type _MockPluginHelperRecorder struct {
+	mock *MockPluginHelper
+}
+
+func NewMockPluginHelper(ctrl *gomock.Controller) *MockPluginHelper {
+	mock := &MockPluginHelper{ctrl: ctrl}
+	mock.recorder = &_MockPluginHelperRecorder{mock}
+	return mock
+}
+
+func (m *MockPluginHelper) EXPECT() *_MockPluginHelperRecorder { return m.recorder }
+
+func (m *MockPluginHelper) PackSupply() chan *PipelinePack {
+	ret := m.ctrl.Call(m, "PackSupply")
+	c, _ := ret[0].(chan *PipelinePack)
+	return c
+}
+
+func (mr *_MockPluginHelperRecorder) PackSupply() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "PackSupply")
+}
+
+func (m *MockPluginHelper) DecodersByEncoding() []DecoderRunner {
+	ret := m.ctrl.Call(m, "DecodersByEncoding")
+	d, _ := ret[0].([]DecoderRunner)
+	return d
+}
+
+func (mr *_MockPluginHelperRecorder) DecodersByEncoding() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "DecodersByEncoding")
+}
+
+func (m *MockPluginHelper) StatAccumulator(name string) (StatAccumulator, error) {
+	ret := m.ctrl.Call(m, "StatAccumulator", name)
+	s, _ := ret[0].(StatAccumulator)
+	err, _ := ret[1].(error)
+	return s, err
+}
+
+func (mr *_MockPluginHelperRecorder) StatAccumulator(name interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "StatAccumulator", name)
+}
+
+// MockStatAccumulator is a gomock-based mock of StatAccumulator.
+type MockStatAccumulator struct {
+	ctrl     *gomock.Controller
+	recorder *_MockStatAccumulatorRecorder
+}
+
+type _MockStatAccumulatorRecorder struct {
+	mock *MockStatAccumulator
+}
+
+func NewMockStatAccumulator(ctrl *gomock.Controller) *MockStatAccumulator {
+	mock := &MockStatAccumulator{ctrl: ctrl}
+	mock.recorder = &_MockStatAccumulatorRecorder{mock}
+	return mock
+}
+
+func (m *MockStatAccumulator) EXPECT() *_MockStatAccumulatorRecorder { return m.recorder }
+
+func (m *MockStatAccumulator) Drop(stat Stat) bool {
+	ret := m.ctrl.Call(m, "Drop", stat)
+	b, _ := ret[0].(bool)
+	return b
+}
+
+func (mr *_MockStatAccumulatorRecorder) Drop(stat interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Drop", stat)
+}
+
+// MockInputRunner is a gomock-based mock of InputRunner.
+type MockInputRunner struct {
+	ctrl     *gomock.Controller
+	recorder *_MockInputRunnerRecorder
+}
+
+type _MockInputRunnerRecorder struct {
+	mock *MockInputRunner
+}
+
+func NewMockInputRunner(ctrl *gomock.Controller) *MockInputRunner {
+	mock := &MockInputRunner{ctrl: ctrl}
+	mock.recorder = &_MockInputRunnerRecorder{mock}
+	return mock
+}
+
+func (m *MockInputRunner) EXPECT() *_MockInputRunnerRecorder { return m.recorder }
+
+func (m *MockInputRunner) Name() string {
+	ret := m.ctrl.Call(m, "Name")
+	s, _ := ret[0].(string)
+	return s
+}
+
+func (mr *_MockInputRunnerRecorder) Name() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Name")
+}
+
+func (m *MockInputRunner) Input() Input {
+	ret := m.ctrl.Call(m, "Input")
+	i, _ := ret[0].(Input)
+	return i
+}
+
+func (mr *_MockInputRunnerRecorder) Input() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Input")
+}
+
+func (m *MockInputRunner) InChan() chan *PipelinePack {
+	ret := m.ctrl.Call(m, "InChan")
+	c, _ := ret[0].(chan *PipelinePack)
+	return c
+}
+
+func (mr *_MockInputRunnerRecorder) InChan() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "InChan")
+}
+
+func (m *MockInputRunner) LogError(err error) {
+	m.ctrl.Call(m, "LogError", err)
+}
+
+func (mr *_MockInputRunnerRecorder) LogError(err interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "LogError", err)
+}
+
+func (m *MockInputRunner) CountRejection(reason string) {
+	m.ctrl.Call(m, "CountRejection", reason)
+}
+
+func (mr *_MockInputRunnerRecorder) CountRejection(reason interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "CountRejection", reason)
+}
+
+func (m *MockInputRunner) RejectionCounts() map[string]int64 {
+	ret := m.ctrl.Call(m, "RejectionCounts")
+	counts, _ := ret[0].(map[string]int64)
+	return counts
+}
+
+func (mr *_MockInputRunnerRecorder) RejectionCounts() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "RejectionCounts")
+}
+
+func (m *MockInputRunner) Start(h PluginHelper, wg *sync.WaitGroup) {
+	m.ctrl.Call(m, "Start", h, wg)
+}
+
+func (mr *_MockInputRunnerRecorder) Start(h, wg interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Start", h, wg)
+}
+
+// MockDecoderRunner is a gomock-based mock of DecoderRunner.
+type MockDecoderRunner struct {
+	ctrl     *gomock.Controller
+	recorder *_MockDecoderRunnerRecorder
+}
+
+type _MockDecoderRunnerRecorder struct {
+	mock *MockDecoderRunner
+}
+
+func NewMockDecoderRunner(ctrl *gomock.Controller) *MockDecoderRunner {
+	mock := &MockDecoderRunner{ctrl: ctrl}
+	mock.recorder = &_MockDecoderRunnerRecorder{mock}
+	return mock
+}
+
+func (m *MockDecoderRunner) EXPECT() *_MockDecoderRunnerRecorder { return m.recorder }
+
+func (m *MockDecoderRunner) InChan() chan *PipelinePack {
+	ret := m.ctrl.Call(m, "InChan")
+	c, _ := ret[0].(chan *PipelinePack)
+	return c
+}
+
+func (mr *_MockDecoderRunnerRecorder) InChan() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "InChan")
+}
+
+func (m *MockDecoderRunner) Decoder() Decoder {
+	ret := m.ctrl.Call(m, "Decoder")
+	d, _ := ret[0].(Decoder)
+	return d
+}
+
+func (mr *_MockDecoderRunnerRecorder) Decoder() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Decoder")
+}
@@ -0,0 +1,37 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"github.com/mozilla-services/heka/message"
+	"github.com/vmihailenco/msgpack"
+)
+
+// MsgPackDecoder decodes message.Message values that have been encoded as
+// msgpack, Heka's lightweight alternative to Protocol Buffers for clients
+// (e.g. Fluentd-style forwarders, embedded agents) that prefer not to
+// carry a protobuf dependency.
+type MsgPackDecoder struct{}
+
+func (d *MsgPackDecoder) Decode(pack *PipelinePack) (err error) {
+	msg := new(message.Message)
+	if err = msgpack.Unmarshal(pack.MsgBytes, msg); err != nil {
+		return fmt.Errorf("can't unmarshal msgpack message: %s", err)
+	}
+	pack.Message = msg
+	pack.Decoded = true
+	return nil
+}
@@ -0,0 +1,47 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"github.com/vmihailenco/msgpack"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+)
+
+func MsgPackDecoderSpec(c gs.Context) {
+	c.Specify("A MsgPackDecoder", func() {
+		decoder := new(MsgPackDecoder)
+		pack := getTestPipelinePack()
+
+		c.Specify("round-trips a full message.Message, including Fields", func() {
+			msg := getTestMessage()
+			msgBytes, err := msgpack.Marshal(msg)
+			c.Assume(err, gs.IsNil)
+			pack.MsgBytes = msgBytes
+
+			err = decoder.Decode(pack)
+			c.Expect(err, gs.IsNil)
+			c.Expect(pack.Decoded, gs.IsTrue)
+			c.Expect(pack.Message.GetPayload(), gs.Equals, msg.GetPayload())
+			c.Expect(pack.Message.Fields["foo"], gs.Equals, "bar")
+		})
+
+		c.Specify("returns an error for a malformed payload", func() {
+			pack.MsgBytes = []byte{0xff, 0xff, 0xff}
+			err := decoder.Decode(pack)
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(pack.Decoded, gs.IsFalse)
+		})
+	})
+}
@@ -0,0 +1,45 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"github.com/mozilla-services/heka/message"
+)
+
+// PipelinePack is the unit of work passed between an input, its decoder,
+// and any downstream filters/outputs. Packs are recycled via PackSupply
+// rather than allocated per message.
+type PipelinePack struct {
+	Message  *message.Message
+	MsgBytes []byte
+	Decoded  bool
+	Signer   string
+}
+
+// NewPipelinePack allocates a pack with a MsgBytes buffer large enough to
+// hold a maximally sized framed message.
+func NewPipelinePack() *PipelinePack {
+	return &PipelinePack{
+		Message:  new(message.Message),
+		MsgBytes: make([]byte, message.MAX_MESSAGE_SIZE+message.MAX_HEADER_SIZE),
+	}
+}
+
+// Zero resets a pack so it can be handed back to a PackSupply for reuse.
+func (p *PipelinePack) Zero() {
+	p.Message.Reset()
+	p.Decoded = false
+	p.Signer = ""
+}
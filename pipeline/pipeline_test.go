@@ -0,0 +1,56 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"github.com/mozilla-services/heka/message"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"testing"
+)
+
+func getTestMessage() *message.Message {
+	hostname := "my.host.name"
+	field := "sample"
+	timestamp := int64(1358969429000000)
+	severity := int32(6)
+	payload := "Example payload"
+	envVersion := "0.8"
+	pid := int32(1234)
+
+	msg := &message.Message{
+		Timestamp:  &timestamp,
+		Type:       &field,
+		Logger:     &field,
+		Severity:   &severity,
+		Payload:    &payload,
+		EnvVersion: &envVersion,
+		Pid:        &pid,
+		Hostname:   &hostname,
+		Fields:     map[string]string{"foo": "bar"},
+	}
+	return msg
+}
+
+func getTestPipelinePack() *PipelinePack {
+	return NewPipelinePack()
+}
+
+func TestAllSpecs(t *testing.T) {
+	r := gs.NewRunner().Parallel(false)
+	r.AddSpec(InputsSpec)
+	r.AddSpec(StatsdInputSpec)
+	r.AddSpec(MsgPackDecoderSpec)
+	gs.MainGoTest(r, t)
+}
@@ -0,0 +1,107 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"sync"
+	"time"
+)
+
+// Plugin is implemented by every pipeline component (inputs, decoders,
+// filters, outputs). Init receives the plugin's config section, already
+// decoded into whatever type the plugin's factory declared.
+type Plugin interface {
+	Init(config interface{}) error
+}
+
+// Input plugins pull or receive data from the outside world, turn it into
+// PipelinePacks, and hand them off to a decoder.
+type Input interface {
+	Plugin
+	// Run should block until the input is stopped, reading data and
+	// feeding it to decoders via the InputRunner/PluginHelper it's given.
+	Run(ir InputRunner, h PluginHelper) (err error)
+	// Stop causes a blocked Run to return.
+	Stop()
+}
+
+// Decoder plugins turn raw bytes into a populated message.Message.
+type Decoder interface {
+	Decode(pack *PipelinePack) (err error)
+}
+
+// DecoderRunner wraps a Decoder with the plumbing needed to run it as part
+// of the pipeline.
+type DecoderRunner interface {
+	// InChan is the channel packs are sent to for decoding.
+	InChan() chan *PipelinePack
+	Decoder() Decoder
+}
+
+// InputRunner wraps an Input with the plumbing needed to run it as part of
+// the pipeline: a name for logging, a supply channel it draws empty packs
+// from, and panic isolation around Run.
+type InputRunner interface {
+	Name() string
+	Input() Input
+	// InChan is the channel of empty packs an input should read from
+	// before populating and handing off to a decoder.
+	InChan() chan *PipelinePack
+	// LogError records a non-fatal error encountered while running.
+	LogError(err error)
+	// CountRejection increments the counter for an inbound message
+	// rejected during verification, keyed by reason (e.g. "bad-hmac",
+	// "unknown-version", "expired-version").
+	CountRejection(reason string)
+	// RejectionCounts returns a snapshot of the counts recorded via
+	// CountRejection, indexed by reason.
+	RejectionCounts() map[string]int64
+	// Start launches the wrapped Input's Run method in its own goroutine,
+	// recovering and logging any panic rather than letting it crash the
+	// process. wg is marked Done when the Input's Run method returns.
+	Start(h PluginHelper, wg *sync.WaitGroup)
+}
+
+// PluginHelper is passed to running plugins so they can reach shared
+// pipeline resources without every plugin needing direct access to the
+// PipelineConfig.
+type PluginHelper interface {
+	// PackSupply returns the channel of recycled, empty PipelinePacks.
+	PackSupply() chan *PipelinePack
+	// DecodersByEncoding returns the set of running decoders, indexed by
+	// the message.Header_MessageEncoding they handle.
+	DecodersByEncoding() []DecoderRunner
+	// StatAccumulator looks up the named StatAccumulator, as configured
+	// elsewhere in the pipeline, for plugins (e.g. StatsdInput) that need
+	// to forward parsed Stats to it.
+	StatAccumulator(name string) (StatAccumulator, error)
+}
+
+// SignerKey is a single HMAC key, valid only for messages arriving within
+// [NotBefore, NotAfter], both ends inclusive. A zero NotBefore or NotAfter leaves that end of
+// the window unbounded.
+type SignerKey struct {
+	Key       string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// Signer holds the HMAC keys accepted from a single named message source,
+// indexed by key version. Rotating in a new version lets a producer
+// switch keys without a hard cutover: both versions verify until the old
+// one's NotAfter passes.
+type Signer struct {
+	Versions map[uint32]SignerKey
+}
@@ -0,0 +1,196 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stat is a single parsed statsd sample, ready to be folded into a
+// StatAccumulator's running aggregates.
+type Stat struct {
+	Bucket   string
+	Value    float64
+	Modifier string // one of "c", "g", "ms", "s", "h"
+	Sampling float64
+	// Delta is only meaningful for "g" (gauge) stats; it's true when the
+	// wire value carried an explicit leading '+' or '-', meaning it should
+	// be applied as an adjustment rather than an absolute value.
+	Delta bool
+}
+
+// StatAccumulator receives parsed Stats from one or more inputs (typically
+// a StatsdInput) and folds them into running aggregates on its own
+// goroutine, flushing the result as a Heka message on a timer.
+type StatAccumulator interface {
+	// Drop hands a Stat off to the accumulator. It returns false if the
+	// accumulator's internal queue is full and the stat had to be
+	// discarded.
+	Drop(stat Stat) bool
+}
+
+// StatAccumulatorConfig is the config struct for a statAccumulator.
+type StatAccumulatorConfig struct {
+	// How often, in seconds, aggregated stats are flushed.
+	FlushInterval int
+	// Percentiles (0-100) to compute for timer/histogram values on flush.
+	Percentiles []float64
+}
+
+type statAccumulator struct {
+	statChan      chan Stat
+	output        chan *PipelinePack
+	packSupply    chan *PipelinePack
+	flushInterval time.Duration
+	percentiles   []float64
+
+	mutex    sync.Mutex
+	counters map[string]float64
+	timers   map[string][]float64
+	gauges   map[string]float64
+	sets     map[string]map[string]bool
+}
+
+// NewStatAccumulator creates a statAccumulator that flushes aggregated
+// messages onto output, drawing empty packs to fill from packSupply.
+func NewStatAccumulator(config *StatAccumulatorConfig, packSupply, output chan *PipelinePack) *statAccumulator {
+	flushInterval := time.Duration(config.FlushInterval) * time.Second
+	if flushInterval <= 0 {
+		flushInterval = 10 * time.Second
+	}
+	return &statAccumulator{
+		statChan:      make(chan Stat, 1000),
+		output:        output,
+		packSupply:    packSupply,
+		flushInterval: flushInterval,
+		percentiles:   config.Percentiles,
+		counters:      make(map[string]float64),
+		timers:        make(map[string][]float64),
+		gauges:        make(map[string]float64),
+		sets:          make(map[string]map[string]bool),
+	}
+}
+
+func (s *statAccumulator) Drop(stat Stat) bool {
+	select {
+	case s.statChan <- stat:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run aggregates incoming Stats until stopChan is closed, flushing on
+// s.flushInterval.
+func (s *statAccumulator) Run(stopChan chan bool) {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case stat := <-s.statChan:
+			s.aggregate(stat)
+		case <-ticker.C:
+			s.flush()
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+func (s *statAccumulator) aggregate(stat Stat) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch stat.Modifier {
+	case "c":
+		sampling := stat.Sampling
+		if sampling <= 0 {
+			sampling = 1
+		}
+		s.counters[stat.Bucket] += stat.Value * (1 / sampling)
+	case "g":
+		if stat.Delta {
+			s.gauges[stat.Bucket] += stat.Value
+		} else {
+			s.gauges[stat.Bucket] = stat.Value
+		}
+	case "ms", "h":
+		s.timers[stat.Bucket] = append(s.timers[stat.Bucket], stat.Value)
+	case "s":
+		set, ok := s.sets[stat.Bucket]
+		if !ok {
+			set = make(map[string]bool)
+			s.sets[stat.Bucket] = set
+		}
+		set[fmt.Sprintf("%v", stat.Value)] = true
+	}
+}
+
+// flush builds a single Heka message carrying all the currently aggregated
+// stats as fields, resets the counters, timers and sets, and sends the
+// pack downstream. Gauges aren't reset; each keeps its last value.
+func (s *statAccumulator) flush() {
+	s.mutex.Lock()
+	fields := make(map[string]string)
+	for bucket, count := range s.counters {
+		fields[fmt.Sprintf("stats.counters.%s.count", bucket)] = fmt.Sprintf("%v", count)
+	}
+	for bucket, value := range s.gauges {
+		fields[fmt.Sprintf("stats.gauges.%s", bucket)] = fmt.Sprintf("%v", value)
+	}
+	for bucket, values := range s.timers {
+		if len(values) == 0 {
+			continue
+		}
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		fields[fmt.Sprintf("stats.timers.%s.count", bucket)] = fmt.Sprintf("%d", len(sorted))
+		fields[fmt.Sprintf("stats.timers.%s.lower", bucket)] = fmt.Sprintf("%v", sorted[0])
+		fields[fmt.Sprintf("stats.timers.%s.upper", bucket)] = fmt.Sprintf("%v", sorted[len(sorted)-1])
+		for _, pct := range s.percentiles {
+			fields[fmt.Sprintf("stats.timers.%s.p%v", bucket, pct)] = fmt.Sprintf("%v", percentile(sorted, pct))
+		}
+	}
+	for bucket, set := range s.sets {
+		fields[fmt.Sprintf("stats.sets.%s.count", bucket)] = fmt.Sprintf("%d", len(set))
+	}
+	s.counters = make(map[string]float64)
+	s.timers = make(map[string][]float64)
+	s.sets = make(map[string]map[string]bool)
+	s.mutex.Unlock()
+
+	if len(fields) == 0 || s.output == nil || s.packSupply == nil {
+		return
+	}
+	pack := <-s.packSupply
+	pack.Message.Fields = fields
+	s.output <- pack
+}
+
+// percentile returns the value at the given percentile (0-100) of an
+// already sorted slice.
+func percentile(sorted []float64, pct float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int((pct / 100) * float64(len(sorted)))
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
@@ -0,0 +1,136 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// StatsdInputConfig is the config struct for a StatsdInput plugin.
+type StatsdInputConfig struct {
+	// Network address to listen to; has the form "host:port".
+	Address string
+	// Name of the StatAccumulator (as fetched via PluginHelper) that
+	// parsed Stats should be forwarded to.
+	StatAccumulator string
+}
+
+// StatsdInput listens on a UDP socket for line-delimited statsd formatted
+// samples ("name:value|type[|@samplerate]") and forwards each as a Stat to
+// a StatAccumulator.
+type StatsdInput struct {
+	listener        net.Conn
+	statAccumulator string
+}
+
+func (s *StatsdInput) Init(config interface{}) (err error) {
+	conf := config.(*StatsdInputConfig)
+	addr, err := net.ResolveUDPAddr("udp", conf.Address)
+	if err != nil {
+		return fmt.Errorf("StatsdInput: can't resolve %s: %s", conf.Address, err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("StatsdInput: can't listen on %s: %s", conf.Address, err)
+	}
+	s.listener = conn
+	s.statAccumulator = conf.StatAccumulator
+	return nil
+}
+
+func (s *StatsdInput) Run(ir InputRunner, h PluginHelper) (err error) {
+	accumulator, err := h.StatAccumulator(s.statAccumulator)
+	if err != nil {
+		return err
+	}
+
+	var buf [512]byte
+	for {
+		n, readErr := s.listener.Read(buf[:])
+		if n > 0 {
+			for _, line := range strings.Split(string(buf[:n]), "\n") {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				stat, err := parseStatLine(line)
+				if err != nil {
+					ir.LogError(err)
+				} else {
+					accumulator.Drop(stat)
+				}
+			}
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+func (s *StatsdInput) Stop() {
+	s.listener.Close()
+}
+
+// parseStatLine parses a single line of statsd wire format:
+// "name:value|type[|@samplerate]". Supported types are "c" (counter), "g"
+// (gauge, with optional leading +/- for deltas), "ms" (timer), "s" (set),
+// and "h" (histogram).
+func parseStatLine(line string) (stat Stat, err error) {
+	line = strings.TrimRight(line, "\r\n")
+	nameValue := strings.SplitN(line, ":", 2)
+	if len(nameValue) != 2 || nameValue[0] == "" {
+		return stat, fmt.Errorf("statsd: malformed line: %q", line)
+	}
+
+	fields := strings.Split(nameValue[1], "|")
+	if len(fields) < 2 {
+		return stat, fmt.Errorf("statsd: malformed line: %q", line)
+	}
+
+	switch fields[1] {
+	case "c", "g", "ms", "s", "h":
+	default:
+		return stat, fmt.Errorf("statsd: unknown stat type: %q", fields[1])
+	}
+
+	sampling := 1.0
+	if len(fields) == 3 {
+		if !strings.HasPrefix(fields[2], "@") {
+			return stat, fmt.Errorf("statsd: malformed sample rate: %q", fields[2])
+		}
+		sampling, err = strconv.ParseFloat(fields[2][1:], 64)
+		if err != nil {
+			return stat, fmt.Errorf("statsd: malformed sample rate: %q", fields[2])
+		}
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return stat, fmt.Errorf("statsd: malformed value: %q", fields[0])
+	}
+
+	stat = Stat{
+		Bucket:   nameValue[0],
+		Value:    value,
+		Modifier: fields[1],
+		Sampling: sampling,
+	}
+	if fields[1] == "g" && (strings.HasPrefix(fields[0], "+") || strings.HasPrefix(fields[0], "-")) {
+		stat.Delta = true
+	}
+	return stat, nil
+}
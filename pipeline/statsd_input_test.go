@@ -0,0 +1,68 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package pipeline
+
+import (
+	"code.google.com/p/gomock/gomock"
+	"errors"
+	ts "github.com/mozilla-services/heka/testsupport"
+	gs "github.com/rafrombrc/gospec/src/gospec"
+	"net"
+)
+
+func StatsdInputSpec(c gs.Context) {
+	t := &ts.SimpleT{}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockHelper := NewMockPluginHelper(ctrl)
+	mockInputRunner := NewMockInputRunner(ctrl)
+	mockAccumulator := NewMockStatAccumulator(ctrl)
+
+	c.Specify("A StatsdInput", func() {
+		statsdInput := StatsdInput{}
+		err := statsdInput.Init(&StatsdInputConfig{"localhost:55565", "test"})
+		c.Assume(err, gs.IsNil)
+		realListener := (statsdInput.listener).(*net.UDPConn)
+		realListener.Close()
+
+		mockListener := ts.NewMockConn(ctrl)
+		statsdInput.listener = mockListener
+
+		c.Specify("reads a counter stat from the connection and forwards it to the accumulator", func() {
+			statLine := "sample.stat:1|c"
+			var statBuf [512]byte
+
+			readCall := mockListener.EXPECT().Read(statBuf[:])
+			readCall.Return(len(statLine), errors.New("connection closed"))
+			readCall.Do(func(b []byte) {
+				copy(b, statLine)
+			})
+
+			mockHelper.EXPECT().StatAccumulator("test").Return(mockAccumulator, nil)
+
+			var dropped Stat
+			mockAccumulator.EXPECT().Drop(gomock.Any()).Do(func(stat Stat) {
+				dropped = stat
+			}).Return(true)
+
+			err = statsdInput.Run(mockInputRunner, mockHelper)
+			c.Expect(err, gs.Not(gs.IsNil))
+			c.Expect(dropped.Bucket, gs.Equals, "sample.stat")
+			c.Expect(dropped.Value, gs.Equals, float64(1))
+			c.Expect(dropped.Modifier, gs.Equals, "c")
+		})
+	})
+}
@@ -0,0 +1,220 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+package testsupport
+
+import (
+	"code.google.com/p/gomock/gomock"
+	"net"
+	"time"
+)
+
+// MockConn is a gomock-based mock of net.Conn, used to drive TcpInput and
+// UdpInput specs without touching a real socket.
+type MockConn struct {
+	ctrl     *gomock.Controller
+	recorder *_MockConnRecorder
+}
+
+type _MockConnRecorder struct {
+	mock *MockConn
+}
+
+func NewMockConn(ctrl *gomock.Controller) *MockConn {
+	mock := &MockConn{ctrl: ctrl}
+	mock.recorder = &_MockConnRecorder{mock}
+	return mock
+}
+
+func (m *MockConn) EXPECT() *_MockConnRecorder { return m.recorder }
+
+func (m *MockConn) Read(b []byte) (n int, err error) {
+	ret := m.ctrl.Call(m, "Read", b)
+	n, _ = ret[0].(int)
+	err, _ = ret[1].(error)
+	return
+}
+
+func (mr *_MockConnRecorder) Read(b interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Read", b)
+}
+
+func (m *MockConn) Write(b []byte) (n int, err error) {
+	ret := m.ctrl.Call(m, "Write", b)
+	n, _ = ret[0].(int)
+	err, _ = ret[1].(error)
+	return
+}
+
+func (mr *_MockConnRecorder) Write(b interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Write", b)
+}
+
+func (m *MockConn) Close() error {
+	ret := m.ctrl.Call(m, "Close")
+	err, _ := ret[0].(error)
+	return err
+}
+
+func (mr *_MockConnRecorder) Close() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Close")
+}
+
+func (m *MockConn) LocalAddr() net.Addr {
+	ret := m.ctrl.Call(m, "LocalAddr")
+	addr, _ := ret[0].(net.Addr)
+	return addr
+}
+
+func (mr *_MockConnRecorder) LocalAddr() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "LocalAddr")
+}
+
+func (m *MockConn) RemoteAddr() net.Addr {
+	ret := m.ctrl.Call(m, "RemoteAddr")
+	addr, _ := ret[0].(net.Addr)
+	return addr
+}
+
+func (mr *_MockConnRecorder) RemoteAddr() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "RemoteAddr")
+}
+
+func (m *MockConn) SetDeadline(t time.Time) error {
+	ret := m.ctrl.Call(m, "SetDeadline", t)
+	err, _ := ret[0].(error)
+	return err
+}
+
+func (mr *_MockConnRecorder) SetDeadline(t interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "SetDeadline", t)
+}
+
+func (m *MockConn) SetReadDeadline(t time.Time) error {
+	ret := m.ctrl.Call(m, "SetReadDeadline", t)
+	err, _ := ret[0].(error)
+	return err
+}
+
+func (mr *_MockConnRecorder) SetReadDeadline(t interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "SetReadDeadline", t)
+}
+
+func (m *MockConn) SetWriteDeadline(t time.Time) error {
+	ret := m.ctrl.Call(m, "SetWriteDeadline", t)
+	err, _ := ret[0].(error)
+	return err
+}
+
+func (mr *_MockConnRecorder) SetWriteDeadline(t interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "SetWriteDeadline", t)
+}
+
+// MockListener is a gomock-based mock of net.Listener.
+type MockListener struct {
+	ctrl     *gomock.Controller
+	recorder *_MockListenerRecorder
+}
+
+type _MockListenerRecorder struct {
+	mock *MockListener
+}
+
+func NewMockListener(ctrl *gomock.Controller) *MockListener {
+	mock := &MockListener{ctrl: ctrl}
+	mock.recorder = &_MockListenerRecorder{mock}
+	return mock
+}
+
+func (m *MockListener) EXPECT() *_MockListenerRecorder { return m.recorder }
+
+func (m *MockListener) Accept() (net.Conn, error) {
+	ret := m.ctrl.Call(m, "Accept")
+	conn, _ := ret[0].(net.Conn)
+	err, _ := ret[1].(error)
+	return conn, err
+}
+
+func (mr *_MockListenerRecorder) Accept() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Accept")
+}
+
+func (m *MockListener) Close() error {
+	ret := m.ctrl.Call(m, "Close")
+	err, _ := ret[0].(error)
+	return err
+}
+
+func (mr *_MockListenerRecorder) Close() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Close")
+}
+
+func (m *MockListener) Addr() net.Addr {
+	ret := m.ctrl.Call(m, "Addr")
+	addr, _ := ret[0].(net.Addr)
+	return addr
+}
+
+func (mr *_MockListenerRecorder) Addr() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Addr")
+}
+
+// MockError is a gomock-based mock of net.Error, used to simulate the
+// non-temporary accept errors that signal a listener has been closed.
+type MockError struct {
+	ctrl     *gomock.Controller
+	recorder *_MockErrorRecorder
+}
+
+type _MockErrorRecorder struct {
+	mock *MockError
+}
+
+func NewMockError(ctrl *gomock.Controller) *MockError {
+	mock := &MockError{ctrl: ctrl}
+	mock.recorder = &_MockErrorRecorder{mock}
+	return mock
+}
+
+func (m *MockError) EXPECT() *_MockErrorRecorder { return m.recorder }
+
+func (m *MockError) Error() string {
+	ret := m.ctrl.Call(m, "Error")
+	s, _ := ret[0].(string)
+	return s
+}
+
+func (mr *_MockErrorRecorder) Error() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Error")
+}
+
+func (m *MockError) Timeout() bool {
+	ret := m.ctrl.Call(m, "Timeout")
+	b, _ := ret[0].(bool)
+	return b
+}
+
+func (mr *_MockErrorRecorder) Timeout() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Timeout")
+}
+
+func (m *MockError) Temporary() bool {
+	ret := m.ctrl.Call(m, "Temporary")
+	b, _ := ret[0].(bool)
+	return b
+}
+
+func (mr *_MockErrorRecorder) Temporary() *gomock.Call {
+	return mr.mock.ctrl.RecordCall(mr.mock, "Temporary")
+}
@@ -0,0 +1,34 @@
+/***** BEGIN LICENSE BLOCK *****
+# This Source Code Form is subject to the terms of the Mozilla Public
+# License, v. 2.0. If a copy of the MPL was not distributed with this file,
+# You can obtain one at http://mozilla.org/MPL/2.0/.
+#
+# The Initial Developer of the Original Code is the Mozilla Foundation.
+# Portions created by the Initial Developer are Copyright (C) 2012
+# the Initial Developer. All Rights Reserved.
+#
+# Contributor(s):
+#   Rob Miller (rmiller@mozilla.com)
+#
+# ***** END LICENSE BLOCK *****/
+
+// Package testsupport holds helpers shared by Heka's gomock-based specs:
+// a gomock.TestReporter shim and hand-rolled mocks for the net types
+// gomock can't generate for (net.Conn, net.Listener, net.Error).
+package testsupport
+
+import (
+	"log"
+)
+
+// SimpleT adapts gomock's TestReporter interface to gospec, which has no
+// *testing.T of its own to hand to a gomock.Controller.
+type SimpleT struct{}
+
+func (t *SimpleT) Errorf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+func (t *SimpleT) Fatalf(format string, args ...interface{}) {
+	log.Fatalf(format, args...)
+}